@@ -0,0 +1,100 @@
+package signer
+
+import (
+	"fmt"
+	"sync"
+
+	sampleissuerapi "github.com/cert-manager/sample-external-issuer/api/v1alpha1"
+)
+
+// IssuerKey identifies the Issuer/ClusterIssuer resource a cached Signer
+// was built for, the same (namespace, name) pair the controller uses to
+// look up the resource itself.
+type IssuerKey struct {
+	Namespace string
+	Name      string
+}
+
+// Cache holds one built Signer per Issuer across reconciles, so a signer
+// like hvcaSigner that pays for an mTLS handshake and policy fetch at
+// construction time isn't rebuilt on every reconcile. The controller's
+// Secret-watch calls Refresh when an issuer's referenced Secret changes,
+// which is what actually drives hvcaSigner.Refresh instead of it sitting
+// unreachable.
+type Cache struct {
+	mu      sync.Mutex
+	signers map[IssuerKey]Signer
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{signers: make(map[IssuerKey]Signer)}
+}
+
+// GetOrBuild returns the cached Signer for key, building and caching one
+// via BuildSigner if none exists yet.
+func (c *Cache) GetOrBuild(key IssuerKey, spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) (Signer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.signers[key]; ok {
+		return s, nil
+	}
+	s, err := BuildSigner(spec, secret, profiles)
+	if err != nil {
+		return nil, err
+	}
+	c.signers[key] = s
+	return s, nil
+}
+
+// Refresh rebuilds key's signer configuration from spec/secret/profiles.
+// If the cached signer is a Refresher, its state is rotated in place;
+// otherwise the old signer is closed (if it's a Closer) and a fresh one
+// built and cached in its place. The controller calls this from its
+// Secret-watch handler whenever an issuer's referenced Secret changes, so
+// a rotated mTLS client key or CA key takes effect without restarting.
+func (c *Cache) Refresh(key IssuerKey, spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, ok := c.signers[key]
+	if !ok {
+		s, err := BuildSigner(spec, secret, profiles)
+		if err != nil {
+			return err
+		}
+		c.signers[key] = s
+		return nil
+	}
+
+	if r, ok := existing.(Refresher); ok {
+		return r.Refresh(spec, secret, profiles)
+	}
+
+	fresh, err := BuildSigner(spec, secret, profiles)
+	if err != nil {
+		return fmt.Errorf("rebuild signer for %s/%s: %w", key.Namespace, key.Name, err)
+	}
+	if closer, ok := existing.(Closer); ok {
+		_ = closer.Close()
+	}
+	c.signers[key] = fresh
+	return nil
+}
+
+// Forget drops and closes the cached signer for key. The controller calls
+// this when the owning Issuer is deleted.
+func (c *Cache) Forget(key IssuerKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.signers[key]
+	if !ok {
+		return
+	}
+	delete(c.signers, key)
+	if closer, ok := s.(Closer); ok {
+		_ = closer.Close()
+	}
+}
@@ -0,0 +1,159 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	sampleissuerapi "github.com/cert-manager/sample-external-issuer/api/v1alpha1"
+)
+
+func init() {
+	Register("cfssl", CFSSLSignerFromIssuerAndSecretData, CFSSLHealthCheckerFromIssuerAndSecretData)
+}
+
+// cfsslSigner signs CSRs via a remote CFSSL server's JSON-over-HTTPS sign
+// API, optionally authenticated with an HMAC auth key the way CFSSL's
+// "authsign" endpoint expects.
+type cfsslSigner struct {
+	url     string
+	authKey []byte
+	// profile is CFSSL's own named signing profile, configured on the
+	// CFSSL server itself; unrelated to this package's Profile type.
+	profile string
+	client  *http.Client
+}
+
+func CFSSLSignerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, _ ProfileSet) (Signer, error) {
+	if spec.URL == "" {
+		return nil, errors.New("cfssl backend requires issuer.spec.url")
+	}
+	return &cfsslSigner{
+		url:     string(spec.URL),
+		authKey: secret["authkey"],
+		profile: string(secret["cfsslProfile"]),
+		client:  http.DefaultClient,
+	}, nil
+}
+
+func CFSSLHealthCheckerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte) (HealthChecker, error) {
+	s, err := CFSSLSignerFromIssuerAndSecretData(spec, secret, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.(*cfsslSigner), nil
+}
+
+// cfsslInfoRequest is CFSSL's /api/v1/cfssl/info request body. The
+// endpoint is registered POST-only, so a GET against it always returns
+// 405 regardless of server health.
+type cfsslInfoRequest struct {
+	Profile string `json:"profile,omitempty"`
+}
+
+// Check hits CFSSL's info endpoint to confirm the server is reachable.
+func (c *cfsslSigner) Check() error {
+	body, err := json.Marshal(cfsslInfoRequest{Profile: c.profile})
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(c.url+"/api/v1/cfssl/info", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cfssl health check: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type cfsslSignRequest struct {
+	CertificateRequest string   `json:"certificate_request"`
+	Hosts              []string `json:"hosts,omitempty"`
+	Profile            string   `json:"profile,omitempty"`
+}
+
+// cfsslAuthEnvelope mirrors CFSSL's auth.AuthenticatedRequest: both fields
+// are raw bytes that json.Marshal base64-encodes, matching what
+// auth.StandardProvider produces and /api/v1/cfssl/authsign expects.
+type cfsslAuthEnvelope struct {
+	Token   []byte `json:"token"`
+	Request []byte `json:"request"`
+}
+
+type cfsslSignResponse struct {
+	Success bool `json:"success"`
+	Result  struct {
+		Certificate string `json:"certificate"`
+	} `json:"result"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (c *cfsslSigner) Sign(csrBytes []byte) ([]byte, []byte, error) {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hosts := append([]string{}, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	signReq, err := json.Marshal(cfsslSignRequest{
+		CertificateRequest: string(csrBytes),
+		Hosts:              hosts,
+		Profile:            c.profile,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endpoint := c.url + "/api/v1/cfssl/sign"
+	body := signReq
+	if len(c.authKey) > 0 {
+		endpoint = c.url + "/api/v1/cfssl/authsign"
+		if body, err = authSignEnvelope(c.authKey, signReq); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	httpResp, err := c.client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp cfsslSignResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, nil, fmt.Errorf("decode cfssl response: %w", err)
+	}
+	if !resp.Success {
+		if len(resp.Errors) > 0 {
+			return nil, nil, fmt.Errorf("cfssl sign failed: %s", resp.Errors[0].Message)
+		}
+		return nil, nil, errors.New("cfssl sign failed")
+	}
+
+	// CFSSL's sign API doesn't return the CA chain; callers retrieve it
+	// out of band from the same CFSSL server if they need it.
+	return []byte(resp.Result.Certificate), nil, nil
+}
+
+// authSignEnvelope wraps request in CFSSL's HMAC auth envelope so it can
+// be posted to the authsign endpoint instead of the unauthenticated one.
+// CFSSL's auth.StandardProvider computes the token as HMAC-SHA256 over the
+// raw request bytes, so it's carried here as []byte rather than hex- or
+// base64-encoded text: json.Marshal base64-encodes []byte fields itself,
+// which is the wire format cfssl.authsign's Verify expects.
+func authSignEnvelope(key, request []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(request)
+	return json.Marshal(cfsslAuthEnvelope{Token: mac.Sum(nil), Request: request})
+}
@@ -0,0 +1,72 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthSignEnvelopeMatchesCFSSLWireFormat(t *testing.T) {
+	key := []byte("test-auth-key")
+	request := []byte(`{"certificate_request":"..."}`)
+
+	body, err := authSignEnvelope(key, request)
+	if err != nil {
+		t.Fatalf("authSignEnvelope returned error: %v", err)
+	}
+
+	var envelope struct {
+		Token   []byte `json:"token"`
+		Request []byte `json:"request"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("envelope did not decode as {token, request} []byte fields: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(request)
+	wantToken := mac.Sum(nil)
+	if !hmac.Equal(envelope.Token, wantToken) {
+		t.Fatalf("token = %x, want HMAC-SHA256(key, request) = %x", envelope.Token, wantToken)
+	}
+	if string(envelope.Request) != string(request) {
+		t.Fatalf("request = %q, want %q", envelope.Request, request)
+	}
+}
+
+func TestCFSSLSignerCheck(t *testing.T) {
+	// CFSSL registers /api/v1/cfssl/info POST-only; a GET against a
+	// healthy server returns 405, so Check must POST.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/cfssl/info" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &cfsslSigner{url: srv.URL, client: srv.Client()}
+	if err := c.Check(); err != nil {
+		t.Fatalf("Check() returned error: %v", err)
+	}
+}
+
+func TestCFSSLSignerCheckRejectsNon200(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := &cfsslSigner{url: srv.URL, client: srv.Client()}
+	if err := c.Check(); err == nil {
+		t.Fatal("expected Check() to fail for a non-200 response")
+	}
+}
+
@@ -0,0 +1,265 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// sctExtensionOID is the X.509v3 extension (RFC 6962 §3.3) used to staple
+// a list of Signed Certificate Timestamps onto a leaf certificate.
+var sctExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+var (
+	ctSubmitLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "atlas_ct_submit_duration_seconds",
+		Help: "Latency of add-chain submissions to Certificate Transparency logs.",
+	}, []string{"log"})
+	ctSubmitErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "atlas_ct_submit_errors_total",
+		Help: "Number of failed add-chain submissions to Certificate Transparency logs.",
+	}, []string{"log"})
+)
+
+// CTLog describes one Certificate Transparency log an issuer submits
+// issued chains to, and whose SCT signature can be verified locally.
+type CTLog struct {
+	// URL is the log's base submission endpoint, e.g.
+	// https://ct.example.com/log. "/ct/v1/add-chain" is appended.
+	URL string
+	// PublicKey is the log's DER-encoded (SubjectPublicKeyInfo) public
+	// key, used to verify the signature on SCTs it returns.
+	PublicKey []byte
+}
+
+// SCT is a verified RFC 6962 Signed Certificate Timestamp returned by one
+// log for a submitted chain.
+type SCT struct {
+	LogURL    string
+	LogID     [32]byte
+	Timestamp time.Time
+	Signature []byte
+	// SignatureAlgo is the TLS SignatureAndHashAlgorithm (RFC 5246 §7.4.1.4.1)
+	// pair identifying how Signature was produced, derived from the log's
+	// own public key type at verification time.
+	SignatureAlgo [2]byte
+}
+
+// sigAndHashForKey returns the TLS SignatureAndHashAlgorithm byte pair for
+// a CT log's public key, as required when embedding its SCTs in a
+// SignedCertificateTimestampList (RFC 6962 §3.3 references RFC 5246).
+func sigAndHashForKey(pub crypto.PublicKey) ([2]byte, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return [2]byte{4, 3}, nil // sha256, ecdsa
+	case *rsa.PublicKey:
+		return [2]byte{4, 1}, nil // sha256, rsa
+	default:
+		return [2]byte{}, fmt.Errorf("unsupported CT log public key type %T", pub)
+	}
+}
+
+// addChainRequest/addChainResponse mirror the RFC 6962 §4.1 add-chain API.
+type addChainRequest struct {
+	Chain [][]byte `json:"chain"`
+}
+
+type addChainResponse struct {
+	SCTVersion int    `json:"sct_version"`
+	ID         []byte `json:"id"`
+	Timestamp  int64  `json:"timestamp"`
+	Extensions []byte `json:"extensions"`
+	Signature  []byte `json:"signature"`
+}
+
+// CollectSCTs submits chain (leaf first) to every log in logs via
+// add-chain, verifies each returned SCT's signature and timestamp, and
+// returns one SCT per log that accepted the chain. It fails with an error
+// only when every submission failed; EnforceMinSCTs applies the minimum.
+func CollectSCTs(logs []CTLog, chain []*x509.Certificate) ([]SCT, error) {
+	scts := make([]SCT, 0, len(logs))
+	var errs []error
+	for _, log := range logs {
+		sct, err := submitToLog(log, chain)
+		if err != nil {
+			ctSubmitErrors.WithLabelValues(log.URL).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", log.URL, err))
+			continue
+		}
+		scts = append(scts, *sct)
+	}
+	if len(errs) > 0 && len(scts) == 0 {
+		return scts, fmt.Errorf("all CT log submissions failed: %v", errs)
+	}
+	return scts, nil
+}
+
+// EnforceMinSCTs fails signing when fewer logs than required accepted the
+// chain, so a CT outage degrades to a hard failure rather than issuing
+// certificates CT monitors will never see.
+func EnforceMinSCTs(scts []SCT, minSCTs int) error {
+	if len(scts) < minSCTs {
+		return fmt.Errorf("atlas CT policy requires %d SCT(s), only got %d", minSCTs, len(scts))
+	}
+	return nil
+}
+
+func submitToLog(log CTLog, chain []*x509.Certificate) (*SCT, error) {
+	req := addChainRequest{Chain: make([][]byte, len(chain))}
+	for i, cert := range chain {
+		req.Chain[i] = cert.Raw
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := prometheus.NewTimer(ctSubmitLatency.WithLabelValues(log.URL))
+	resp, err := http.Post(log.URL+"/ct/v1/add-chain", "application/json", bytes.NewReader(body))
+	timer.ObserveDuration()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("log returned status %d", resp.StatusCode)
+	}
+
+	var ac addChainResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ac); err != nil {
+		return nil, fmt.Errorf("decode add-chain response: %w", err)
+	}
+	if len(ac.ID) != 32 {
+		return nil, errors.New("log id is not 32 bytes")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(log.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse log public key: %w", err)
+	}
+	sigAlgo, err := sigAndHashForKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	ts := time.UnixMilli(ac.Timestamp).UTC()
+	if err := verifySCTSignature(pub, chain[0], ac, ts); err != nil {
+		return nil, fmt.Errorf("verify SCT signature: %w", err)
+	}
+	if ts.After(time.Now().Add(time.Minute)) {
+		return nil, fmt.Errorf("SCT timestamp %s is in the future", ts)
+	}
+
+	var sct SCT
+	sct.LogURL = log.URL
+	copy(sct.LogID[:], ac.ID)
+	sct.Timestamp = ts
+	sct.Signature = ac.Signature
+	sct.SignatureAlgo = sigAlgo
+	return &sct, nil
+}
+
+// signedCertificateTimestampInput builds the "CertificateTimestamp" signed
+// structure from RFC 6962 §3.2 that a log's signature covers.
+func signedCertificateTimestampInput(leaf *x509.Certificate, ac addChainResponse, ts time.Time) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0) // version: v1
+	buf.WriteByte(0) // signature_type: certificate_timestamp
+	var tsBytes [8]byte
+	binary.BigEndian.PutUint64(tsBytes[:], uint64(ts.UnixMilli()))
+	buf.Write(tsBytes[:])
+	buf.Write([]byte{0, 0}) // entry_type: x509_entry
+	var lenBytes [3]byte
+	putUint24(lenBytes[:], uint32(len(leaf.Raw)))
+	buf.Write(lenBytes[:])
+	buf.Write(leaf.Raw)
+	var extLen [2]byte
+	binary.BigEndian.PutUint16(extLen[:], uint16(len(ac.Extensions)))
+	buf.Write(extLen[:])
+	buf.Write(ac.Extensions)
+	return buf.Bytes()
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
+
+func verifySCTSignature(pub crypto.PublicKey, leaf *x509.Certificate, ac addChainResponse, ts time.Time) error {
+	digest := sha256.Sum256(signedCertificateTimestampInput(leaf, ac, ts))
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], ac.Signature) {
+			return errors.New("ecdsa signature verification failed")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], ac.Signature); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported CT log public key type %T", pub)
+	}
+	return nil
+}
+
+// SCTListExtension builds the sctExtensionOID certificate extension from
+// scts, for the rare path where an Atlas-issued precert needs its final
+// leaf reassembled with SCTs embedded rather than stapled out-of-band.
+func SCTListExtension(scts []SCT) (pkix.Extension, error) {
+	value, err := sctListExtension(scts)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: sctExtensionOID, Value: value}, nil
+}
+
+// sctListExtension encodes scts as the TLS SignedCertificateTimestampList
+// structure (RFC 6962 §3.3), ready to embed in sctExtensionOID.
+func sctListExtension(scts []SCT) ([]byte, error) {
+	var list bytes.Buffer
+	for _, sct := range scts {
+		var entry bytes.Buffer
+		entry.WriteByte(0) // sct_version: v1
+		entry.Write(sct.LogID[:])
+		var tsBytes [8]byte
+		binary.BigEndian.PutUint64(tsBytes[:], uint64(sct.Timestamp.UnixMilli()))
+		entry.Write(tsBytes[:])
+		entry.Write([]byte{0, 0}) // no SCT extensions
+		if sct.SignatureAlgo == ([2]byte{}) {
+			return nil, fmt.Errorf("sct for log %s has no signature algorithm recorded", sct.LogURL)
+		}
+		entry.Write(sct.SignatureAlgo[:])
+		var sigLen [2]byte
+		binary.BigEndian.PutUint16(sigLen[:], uint16(len(sct.Signature)))
+		entry.Write(sigLen[:])
+		entry.Write(sct.Signature)
+
+		var entryLen [2]byte
+		binary.BigEndian.PutUint16(entryLen[:], uint16(entry.Len()))
+		list.Write(entryLen[:])
+		list.Write(entry.Bytes())
+	}
+
+	var listLen [2]byte
+	binary.BigEndian.PutUint16(listLen[:], uint16(list.Len()))
+
+	der, err := asn1.Marshal(append(listLen[:], list.Bytes()...))
+	if err != nil {
+		return nil, err
+	}
+	return der, nil
+}
@@ -0,0 +1,145 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func selfSignedLeaf(t *testing.T) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func signSCT(t *testing.T, leaf *x509.Certificate, logKey *ecdsa.PrivateKey, ts time.Time) addChainResponse {
+	t.Helper()
+	ac := addChainResponse{Timestamp: ts.UnixMilli()}
+	digest := sha256.Sum256(signedCertificateTimestampInput(leaf, ac, ts))
+	sig, err := ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac.ID = make([]byte, 32)
+	ac.Signature = sig
+	return ac
+}
+
+func TestVerifySCTSignatureRoundTrip(t *testing.T) {
+	leaf := selfSignedLeaf(t)
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Now().Add(-time.Minute)
+	ac := signSCT(t, leaf, logKey, ts)
+
+	if err := verifySCTSignature(&logKey.PublicKey, leaf, ac, ts); err != nil {
+		t.Fatalf("verifySCTSignature() returned error for a validly signed SCT: %v", err)
+	}
+}
+
+func TestVerifySCTSignatureRejectsTampering(t *testing.T) {
+	leaf := selfSignedLeaf(t)
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Now().Add(-time.Minute)
+	ac := signSCT(t, leaf, logKey, ts)
+	tamperedTS := ts.Add(time.Second) // verify against a different timestamp than was signed
+
+	if err := verifySCTSignature(&logKey.PublicKey, leaf, ac, tamperedTS); err == nil {
+		t.Fatal("expected verifySCTSignature() to reject a tampered timestamp")
+	}
+}
+
+func TestSigAndHashForKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := sigAndHashForKey(&ecKey.PublicKey); err != nil || got != ([2]byte{4, 3}) {
+		t.Fatalf("sigAndHashForKey(ecdsa) = %v, %v, want {4,3}, nil", got, err)
+	}
+	if got, err := sigAndHashForKey(&rsaKey.PublicKey); err != nil || got != ([2]byte{4, 1}) {
+		t.Fatalf("sigAndHashForKey(rsa) = %v, %v, want {4,1}, nil", got, err)
+	}
+}
+
+func TestSCTListExtensionUsesPerSCTSignatureAlgo(t *testing.T) {
+	scts := []SCT{
+		{LogURL: "https://log-ecdsa", SignatureAlgo: [2]byte{4, 3}, Signature: []byte("sig1")},
+		{LogURL: "https://log-rsa", SignatureAlgo: [2]byte{4, 1}, Signature: []byte("sig2")},
+	}
+	ext, err := SCTListExtension(scts)
+	if err != nil {
+		t.Fatalf("SCTListExtension() returned error: %v", err)
+	}
+	if !ext.Id.Equal(sctExtensionOID) {
+		t.Fatalf("extension OID = %v, want %v", ext.Id, sctExtensionOID)
+	}
+
+	var list []byte
+	if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+		t.Fatalf("extension value is not an OCTET STRING: %v", err)
+	}
+	// Each entry ends with its SignatureAlgo, a 2-byte signature length and
+	// the signature itself.
+	for _, want := range [][]byte{
+		append([]byte{4, 3, 0, 4}, "sig1"...),
+		append([]byte{4, 1, 0, 4}, "sig2"...),
+	} {
+		if !bytes.Contains(list, want) {
+			t.Fatalf("SCT list %x does not contain entry tail %x", list, want)
+		}
+	}
+}
+
+func TestSCTListExtensionRejectsMissingSignatureAlgo(t *testing.T) {
+	scts := []SCT{{LogURL: "https://log-unknown", Signature: []byte("sig")}}
+	if _, err := SCTListExtension(scts); err == nil {
+		t.Fatal("expected SCTListExtension() to reject an SCT with no recorded signature algorithm")
+	}
+}
+
+func TestEnforceMinSCTs(t *testing.T) {
+	scts := []SCT{{LogURL: "https://log-a"}, {LogURL: "https://log-b"}}
+	if err := EnforceMinSCTs(scts, 2); err != nil {
+		t.Fatalf("unexpected error with enough SCTs: %v", err)
+	}
+	if err := EnforceMinSCTs(scts, 3); err == nil {
+		t.Fatal("expected an error when fewer logs accepted the chain than required")
+	}
+}
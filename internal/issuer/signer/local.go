@@ -0,0 +1,177 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	sampleissuerapi "github.com/cert-manager/sample-external-issuer/api/v1alpha1"
+	"github.com/iamantil/atlas-cert-manager/pkg/hsm"
+)
+
+func init() {
+	Register("local", LocalSignerFromIssuerAndSecretData, LocalHealthCheckerFromIssuerAndSecretData)
+}
+
+// defaultLocalExpiry is used when the issuer doesn't select a Profile.
+const defaultLocalExpiry = 90 * 24 * time.Hour
+
+// localSigner signs CSRs directly from a CA cert+key held in the issuer
+// secret (or on an HSM), without talking to any remote CA.
+type localSigner struct {
+	caCert  *x509.Certificate
+	caKey   crypto.Signer
+	profile *Profile
+}
+
+func LocalSignerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) (Signer, error) {
+	var profile *Profile
+	if spec.Profile != "" {
+		p, ok := profiles[spec.Profile]
+		if !ok {
+			return nil, fmt.Errorf("issuer selects profile %q but it is not present in the referenced ConfigMap", spec.Profile)
+		}
+		profile = &p
+	}
+
+	certBlock, _ := pem.Decode(secret["cacert"])
+	if certBlock == nil {
+		return nil, errors.New("local backend requires a \"cacert\" PEM entry in the issuer secret")
+	}
+	caCert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	caKey, err := localCAKeyFromSecretData(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localSigner{caCert: caCert, caKey: caKey, profile: profile}, nil
+}
+
+// localCAKeyFromSecretData reads the CA private key either from a PEM
+// block (PKCS#1 or PKCS#8) or from an HSM, mirroring how the HVCA driver
+// resolves its mTLS client key.
+func localCAKeyFromSecretData(secret map[string][]byte) (crypto.Signer, error) {
+	if cfg, ok := hsmConfigFromSecretData(secret); ok {
+		return hsm.Open(cfg)
+	}
+
+	keyBlock, _ := pem.Decode(secret["cakey"])
+	if keyBlock == nil {
+		return nil, errors.New("local backend requires a \"cakey\" PEM entry in the issuer secret")
+	}
+	switch keyBlock.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("local backend: PKCS8 CA key does not implement crypto.Signer")
+		}
+		return signer, nil
+	default:
+		return nil, errors.New("unable to determine the CA private key type")
+	}
+}
+
+func LocalHealthCheckerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte) (HealthChecker, error) {
+	s, err := LocalSignerFromIssuerAndSecretData(spec, secret, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.(*localSigner), nil
+}
+
+// Check confirms the configured CA certificate hasn't expired.
+func (l *localSigner) Check() error {
+	if time.Now().After(l.caCert.NotAfter) {
+		return fmt.Errorf("local CA certificate expired at %s", l.caCert.NotAfter)
+	}
+	return nil
+}
+
+func (l *localSigner) Sign(csrBytes []byte) ([]byte, []byte, error) {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expiry := defaultLocalExpiry
+	if l.profile != nil {
+		if d, err := time.ParseDuration(l.profile.Expiry); err == nil {
+			expiry = d
+		}
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(expiry),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if l.profile != nil {
+		if allowed := l.profile.allowedSANSet(); allowed != nil {
+			tmpl.DNSNames = filterStrings(tmpl.DNSNames, allowed)
+			ips := tmpl.IPAddresses[:0]
+			for _, ip := range tmpl.IPAddresses {
+				if allowed[ip.String()] {
+					ips = append(ips, ip)
+				}
+			}
+			tmpl.IPAddresses = ips
+		}
+
+		ku, eku, err := l.profile.x509Usages()
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpl.KeyUsage = ku
+		tmpl.ExtKeyUsage = eku
+
+		if l.profile.CAConstraint != nil {
+			tmpl.IsCA = l.profile.CAConstraint.IsCA
+			tmpl.BasicConstraintsValid = true
+			if tmpl.IsCA {
+				tmpl.MaxPathLen = l.profile.CAConstraint.MaxPathLen
+				tmpl.MaxPathLenZero = l.profile.CAConstraint.MaxPathLen == 0
+				tmpl.KeyUsage |= x509.KeyUsageCertSign
+			}
+		}
+
+		exts, err := l.profile.extensions()
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpl.ExtraExtensions = exts
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, l.caCert, csr.PublicKey, l.caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: l.caCert.Raw}),
+		nil
+}
@@ -0,0 +1,122 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func localTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "local test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func localTestCSR(t *testing.T, commonName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestLocalSignerAppliesProfileUsages(t *testing.T) {
+	caCert, caKey := localTestCA(t)
+	profile := &Profile{
+		Usages: []string{"digital signature", "key encipherment", "server auth"},
+		Expiry: "1h",
+	}
+	l := &localSigner{caCert: caCert, caKey: caKey, profile: profile}
+
+	certPEM, _, err := l.Sign(localTestCSR(t, "leaf.example.com"))
+	if err != nil {
+		t.Fatalf("Sign() returned error: %v", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantKU := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	if cert.KeyUsage != wantKU {
+		t.Fatalf("KeyUsage = %v, want %v", cert.KeyUsage, wantKU)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Fatalf("ExtKeyUsage = %v, want [ServerAuth]", cert.ExtKeyUsage)
+	}
+	if cert.IsCA {
+		t.Fatal("expected a non-CA certificate when the profile sets no caConstraint")
+	}
+}
+
+func TestLocalSignerAppliesCAConstraint(t *testing.T) {
+	caCert, caKey := localTestCA(t)
+	profile := &Profile{
+		Usages:       []string{"cert sign"},
+		Expiry:       "1h",
+		CAConstraint: &CAConstraint{IsCA: true, MaxPathLen: 1},
+	}
+	l := &localSigner{caCert: caCert, caKey: caKey, profile: profile}
+
+	certPEM, _, err := l.Sign(localTestCSR(t, "intermediate.example.com"))
+	if err != nil {
+		t.Fatalf("Sign() returned error: %v", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cert.IsCA {
+		t.Fatal("expected a CA certificate when the profile sets caConstraint.isCA")
+	}
+	if cert.MaxPathLen != 1 || cert.MaxPathLenZero {
+		t.Fatalf("MaxPathLen = %d (zero=%v), want 1 (zero=false)", cert.MaxPathLen, cert.MaxPathLenZero)
+	}
+}
+
+func TestLocalSignerRejectsUnknownUsage(t *testing.T) {
+	caCert, caKey := localTestCA(t)
+	profile := &Profile{Usages: []string{"not a real usage"}, Expiry: "1h"}
+	l := &localSigner{caCert: caCert, caKey: caKey, profile: profile}
+
+	if _, _, err := l.Sign(localTestCSR(t, "leaf.example.com")); err == nil {
+		t.Fatal("expected Sign() to reject a profile with an unknown usage")
+	}
+}
@@ -0,0 +1,235 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/hvclient"
+)
+
+// Profile mirrors CFSSL's config.SigningProfile: a named, operator-defined
+// policy that controls what an issuance under it is allowed to produce,
+// independent of whatever the CSR itself asks for. Issuers select a
+// Profile by name instead of relying on the single hard-coded signing path
+// in hvcaSigner.Sign.
+type Profile struct {
+	// Usages lists the key usages / extended key usages this profile
+	// grants, e.g. "server auth", "client auth", "code signing".
+	Usages []string `json:"usages"`
+	// Expiry is the requested certificate lifetime, as a Go duration
+	// string, e.g. "2160h".
+	Expiry string `json:"expiry"`
+	// CAConstraint marks whether certificates issued under this profile
+	// are themselves allowed to be CAs.
+	CAConstraint *CAConstraint `json:"caConstraint,omitempty"`
+	// AllowedSANs restricts which DNS names/IPs a CSR signed under this
+	// profile may request. An empty list means "whatever the CSR
+	// contains, subject to the atlas validation policy".
+	AllowedSANs []string `json:"allowedSANs,omitempty"`
+	// ExtraExtensions lists additional X.509 extensions to stamp onto any
+	// certificate issued under this profile.
+	ExtraExtensions []ExtraExtension `json:"extraExtensions,omitempty"`
+}
+
+// CAConstraint captures the basic constraints a profile grants to the
+// certificates it issues.
+type CAConstraint struct {
+	IsCA       bool `json:"isCA"`
+	MaxPathLen int  `json:"maxPathLen"`
+}
+
+// ExtraExtension is a policy-controlled X.509 extension to inject into a
+// signing request, keyed by OID rather than a well-known Go type so that
+// profiles can express extensions hvclient.Request doesn't model directly.
+type ExtraExtension struct {
+	OID string `json:"oid"`
+	// Critical marks the extension as RFC 5280 critical.
+	Critical bool `json:"critical"`
+	// ValueBase64 is the DER-encoded extension value, base64-encoded so
+	// it round-trips cleanly through a ConfigMap.
+	ValueBase64 string `json:"valueBase64"`
+}
+
+// ProfileSet is the decoded form of the ConfigMap an IssuerSpec points at
+// via ProfilesConfigMapRef: a named set of Profiles the issuer may select
+// between.
+type ProfileSet map[string]Profile
+
+// ParseProfileSet decodes a ConfigMap's Data into a ProfileSet. Each entry
+// is a JSON-encoded Profile keyed by profile name, e.g. "server", "client",
+// "code-signing".
+func ParseProfileSet(data map[string]string) (ProfileSet, error) {
+	profiles := make(ProfileSet, len(data))
+	for name, raw := range data {
+		var p Profile
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// validate checks that a Profile is internally consistent, independent of
+// any remote Atlas validation policy.
+func (p Profile) validate() error {
+	if len(p.Usages) == 0 {
+		return errors.New("profile must set at least one usage")
+	}
+	if p.Expiry == "" {
+		return errors.New("profile must set an expiry")
+	}
+	if _, err := time.ParseDuration(p.Expiry); err != nil {
+		return fmt.Errorf("expiry %q is not a valid duration: %w", p.Expiry, err)
+	}
+	for _, ext := range p.ExtraExtensions {
+		if ext.OID == "" {
+			return errors.New("extraExtensions entry is missing an oid")
+		}
+		if _, err := parseOID(ext.OID); err != nil {
+			return fmt.Errorf("extraExtensions %q: %w", ext.OID, err)
+		}
+		if _, err := base64.StdEncoding.DecodeString(ext.ValueBase64); err != nil {
+			return fmt.Errorf("extraExtensions %q: valueBase64 is not valid base64: %w", ext.OID, err)
+		}
+	}
+	return nil
+}
+
+// validateAgainstPolicy fails fast when a profile asks for something the
+// remote Atlas validation policy won't allow, so a misconfigured profile
+// is caught at issuer-reconcile time rather than at signing time.
+func (p Profile) validateAgainstPolicy(vp *hvclient.Policy) error {
+	if p.CAConstraint != nil && p.CAConstraint.IsCA {
+		return errors.New("profile requests a CA constraint but the HVCA leaf-signing path does not support issuing CA certificates")
+	}
+	if len(p.AllowedSANs) > 0 && vp.SAN.DNSNames.MaxCount > 0 && len(p.AllowedSANs) > vp.SAN.DNSNames.MaxCount {
+		return fmt.Errorf("profile allows %d SANs but atlas validation policy permits at most %d", len(p.AllowedSANs), vp.SAN.DNSNames.MaxCount)
+	}
+	return nil
+}
+
+// ValidateProfileSet re-validates every profile in the set against the
+// remote Atlas policy. The controller calls this during issuer-reconcile,
+// after loading the ConfigMap and fetching the policy, so a bad profile
+// surfaces as a reconcile error instead of a signing failure later on.
+func ValidateProfileSet(profiles ProfileSet, vp *hvclient.Policy) error {
+	for name, p := range profiles {
+		if err := p.validateAgainstPolicy(vp); err != nil {
+			return fmt.Errorf("profile %q violates atlas validation policy: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// allowedSANSet returns p.AllowedSANs as a lookup set, or nil when the
+// profile doesn't restrict SANs.
+func (p Profile) allowedSANSet() map[string]bool {
+	if len(p.AllowedSANs) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(p.AllowedSANs))
+	for _, san := range p.AllowedSANs {
+		set[san] = true
+	}
+	return set
+}
+
+// extensions decodes ExtraExtensions into pkix.Extension values ready to
+// attach to an outgoing HVCA request.
+func (p Profile) extensions() ([]pkix.Extension, error) {
+	exts := make([]pkix.Extension, 0, len(p.ExtraExtensions))
+	for _, e := range p.ExtraExtensions {
+		oid, err := parseOID(e.OID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := base64.StdEncoding.DecodeString(e.ValueBase64)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{
+			Id:       oid,
+			Critical: e.Critical,
+			Value:    value,
+		})
+	}
+	return exts, nil
+}
+
+// keyUsageStrings maps CFSSL-style usage names to the x509.KeyUsage bit
+// they set. extKeyUsageStrings below covers the extended key usages; a
+// profile usage name may appear in either map, or both.
+var keyUsageStrings = map[string]x509.KeyUsage{
+	"digital signature":  x509.KeyUsageDigitalSignature,
+	"content commitment": x509.KeyUsageContentCommitment,
+	"key encipherment":   x509.KeyUsageKeyEncipherment,
+	"key agreement":      x509.KeyUsageKeyAgreement,
+	"data encipherment":  x509.KeyUsageDataEncipherment,
+	"cert sign":          x509.KeyUsageCertSign,
+	"crl sign":           x509.KeyUsageCRLSign,
+	"encipher only":      x509.KeyUsageEncipherOnly,
+	"decipher only":      x509.KeyUsageDecipherOnly,
+}
+
+var extKeyUsageStrings = map[string]x509.ExtKeyUsage{
+	"any":              x509.ExtKeyUsageAny,
+	"server auth":      x509.ExtKeyUsageServerAuth,
+	"client auth":      x509.ExtKeyUsageClientAuth,
+	"code signing":     x509.ExtKeyUsageCodeSigning,
+	"email protection": x509.ExtKeyUsageEmailProtection,
+	"s/mime":           x509.ExtKeyUsageEmailProtection,
+	"timestamping":     x509.ExtKeyUsageTimeStamping,
+	"ocsp signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// x509Usages translates p.Usages into the x509.KeyUsage bitmask and
+// x509.ExtKeyUsage list a certificate template should carry. An unknown
+// usage name is rejected rather than silently dropped, since a typo'd
+// usage would otherwise issue a certificate with weaker guarantees than
+// the profile promised.
+func (p Profile) x509Usages() (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var ku x509.KeyUsage
+	var eku []x509.ExtKeyUsage
+	for _, usage := range p.Usages {
+		name := strings.ToLower(usage)
+		matched := false
+		if bit, ok := keyUsageStrings[name]; ok {
+			ku |= bit
+			matched = true
+		}
+		if ext, ok := extKeyUsageStrings[name]; ok {
+			eku = append(eku, ext)
+			matched = true
+		}
+		if !matched {
+			return 0, nil, fmt.Errorf("profile: unknown usage %q", usage)
+		}
+	}
+	return ku, eku, nil
+}
+
+// parseOID parses a dotted-decimal OID string, e.g. "1.3.6.1.4.1.11129.2.4.2".
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
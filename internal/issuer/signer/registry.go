@@ -0,0 +1,81 @@
+package signer
+
+import (
+	"fmt"
+	"sync"
+
+	sampleissuerapi "github.com/cert-manager/sample-external-issuer/api/v1alpha1"
+)
+
+// defaultBackend is used when an issuer doesn't set spec.Backend, so
+// existing issuers created before the registry existed keep talking to
+// HVCA without a migration.
+const defaultBackend = "hvca"
+
+// backend pairs the builders that make up one pluggable signing backend.
+type backend struct {
+	signer        SignerBuilder
+	healthChecker HealthCheckerBuilder
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]backend{}
+)
+
+// Register adds a signing backend under name, e.g. "hvca", "cfssl",
+// "local". Drivers call this from an init() in their own file so the
+// registry is populated purely by which files are compiled in, the same
+// way database/sql drivers register themselves.
+func Register(name string, b SignerBuilder, h HealthCheckerBuilder) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = backend{signer: b, healthChecker: h}
+}
+
+// Lookup returns the builders registered under name. The controller calls
+// this during issuer reconciliation and must reject the issuer when it
+// returns an error, rather than falling back to a default backend.
+func Lookup(name string) (SignerBuilder, HealthCheckerBuilder, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	b, ok := registry[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("signer: no backend registered for %q", name)
+	}
+	return b.signer, b.healthChecker, nil
+}
+
+func init() {
+	Register("hvca", HVCASignerFromIssuerAndSecretData, HVCAHealthCheckerFromIssuerAndSecretData)
+}
+
+// backendName returns spec.Backend, defaulting to defaultBackend when unset.
+func backendName(spec *sampleissuerapi.IssuerSpec) string {
+	if spec.Backend == "" {
+		return defaultBackend
+	}
+	return spec.Backend
+}
+
+// BuildSigner is the entry point the controller calls during issuer
+// reconciliation: it resolves spec.Backend through the registry and fails
+// the reconcile with a clear error when the issuer selects a backend that
+// isn't compiled in, rather than silently falling back to hvca.
+func BuildSigner(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) (Signer, error) {
+	build, _, err := Lookup(backendName(spec))
+	if err != nil {
+		return nil, err
+	}
+	return build(spec, secret, profiles)
+}
+
+// BuildHealthChecker is BuildSigner's counterpart for the controller's
+// periodic health check reconciliation.
+func BuildHealthChecker(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte) (HealthChecker, error) {
+	_, build, err := Lookup(backendName(spec))
+	if err != nil {
+		return nil, err
+	}
+	return build(spec, secret)
+}
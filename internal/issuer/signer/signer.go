@@ -3,17 +3,27 @@ package signer
 import (
 	"context"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	sampleissuerapi "github.com/cert-manager/sample-external-issuer/api/v1alpha1"
 	"github.com/globalsign/hvclient"
+	"github.com/iamantil/atlas-cert-manager/pkg/hsm"
 )
 
 var err error
 
+// defaultPolicyCacheTTL is how long a fetched validation policy is reused
+// for when IssuerSpec.PolicyCacheTTL is unset.
+const defaultPolicyCacheTTL = 5 * time.Minute
+
 type HealthChecker interface {
 	Check() error
 }
@@ -24,43 +34,388 @@ type Signer interface {
 	Sign([]byte) ([]byte, []byte, error)
 }
 
-type SignerBuilder func(*sampleissuerapi.IssuerSpec, map[string][]byte) (Signer, error)
+// SignerBuilder also receives the ProfileSet decoded from the ConfigMap an
+// IssuerSpec references (if any), so the signer can enforce a
+// operator-defined profile instead of the single hard-coded signing path.
+type SignerBuilder func(*sampleissuerapi.IssuerSpec, map[string][]byte, ProfileSet) (Signer, error)
+
+// Refresher is implemented by signers that can swap in a new spec/secret
+// without discarding in-flight state (hvcaSigner does this to rotate its
+// mTLS client without dropping a Sign call that's already in progress).
+// Cache uses this to rotate a cached signer in place instead of always
+// rebuilding it from scratch.
+type Refresher interface {
+	Refresh(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) error
+}
+
+// Closer is implemented by signers that hold a resource (an mTLS
+// connection, an HSM session) that must be released when the owning
+// Issuer is deleted.
+type Closer interface {
+	Close() error
+}
+
+var (
+	_ Refresher = (*hvcaSigner)(nil)
+	_ Closer    = (*hvcaSigner)(nil)
+)
 
-func HVCAHealthCheckerFromIssuerAndSecretData(*sampleissuerapi.IssuerSpec, map[string][]byte) (HealthChecker, error) {
+func HVCAHealthCheckerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte) (HealthChecker, error) {
+	if cfg, ok := hsmConfigFromSecretData(secret); ok {
+		return hsm.NewHealthChecker(cfg), nil
+	}
 	return &hvcaSigner{}, nil
 }
 
-func HVCASignerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte) (Signer, error) {
+func HVCASignerFromIssuerAndSecretData(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) (Signer, error) {
+	var profile *Profile
+	if spec.Profile != "" {
+		p, ok := profiles[spec.Profile]
+		if !ok {
+			return nil, fmt.Errorf("issuer selects profile %q but it is not present in the referenced ConfigMap", spec.Profile)
+		}
+		profile = &p
+	}
+	if profile != nil && len(profile.ExtraExtensions) > 0 {
+		// hvclient.Request has no field for raw certificate extensions, so
+		// there's no way to honor this against the real HVCA API. Reject it
+		// once here, at construction/reconcile time, rather than letting
+		// every Sign call for this issuer fail: a profile with
+		// ExtraExtensions set is simply incompatible with the hvca backend.
+		return nil, fmt.Errorf("profile %q sets extraExtensions, which the hvca backend does not support", spec.Profile)
+	}
+
 	hvconfig := new(hvclient.Config)
 	hvconfig.APIKey = string(secret["apikey"])
 	hvconfig.APISecret = string(secret["apisecret"])
 	hvconfig.URL = string(spec.URL)
 	// decode pem to der expected by HVCA signer
 	certDER, _ := pem.Decode(secret["cert"])
-	keyDER, _ := pem.Decode(secret["certkey"])
 	if hvconfig.TLSCert, err = x509.ParseCertificate(certDER.Bytes); err != nil {
 		return nil, err
 	}
-	// Parse the mTLS cert private key in PKCS1 or PKCS8 format
-	if keyDER.Type == "RSA PRIVATE KEY" {
-		if hvconfig.TLSKey, err = x509.ParsePKCS1PrivateKey(keyDER.Bytes); err != nil {
-			return nil, err
-		}
-	} else if keyDER.Type == "PRIVATE KEY" {
-		if hvconfig.TLSKey, err = x509.ParsePKCS8PrivateKey(keyDER.Bytes); err != nil {
+	// The mTLS client key can either live in the secret as a PEM block, or
+	// stay on a PKCS#11 token (HSM) that never exposes the raw key.
+	if cfg, ok := hsmConfigFromSecretData(secret); ok {
+		tlsKey, err := hsm.Open(cfg)
+		if err != nil {
 			return nil, err
 		}
+		hvconfig.TLSKey = tlsKey
 	} else {
-		return nil, errors.New("unable to determine the mTLS private key type")
+		keyDER, _ := pem.Decode(secret["certkey"])
+		// Parse the mTLS cert private key in PKCS1 or PKCS8 format
+		if keyDER.Type == "RSA PRIVATE KEY" {
+			if hvconfig.TLSKey, err = x509.ParsePKCS1PrivateKey(keyDER.Bytes); err != nil {
+				return nil, err
+			}
+		} else if keyDER.Type == "PRIVATE KEY" {
+			if hvconfig.TLSKey, err = x509.ParsePKCS8PrivateKey(keyDER.Bytes); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, errors.New("unable to determine the mTLS private key type")
+		}
 	}
 	if err = hvconfig.Validate(); err != nil {
 		return nil, err
 	}
-	return &hvcaSigner{config: hvconfig}, nil
+
+	policyTTL := defaultPolicyCacheTTL
+	if spec.PolicyCacheTTL != "" {
+		if policyTTL, err = time.ParseDuration(spec.PolicyCacheTTL); err != nil {
+			return nil, fmt.Errorf("invalid policyCacheTTL %q: %w", spec.PolicyCacheTTL, err)
+		}
+	}
+
+	// The HVCA client performs its mTLS handshake once, here, rather than
+	// on every Sign call. ctx is cancelled by Close when the issuer is
+	// deleted, tearing the client down with it.
+	clntCtx, cancel := context.WithCancel(context.Background())
+	clnt, err := hvclient.NewClient(clntCtx, hvconfig)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &hvcaSigner{
+		config:    hvconfig,
+		profile:   profile,
+		ctLogs:    ctLogsFromSpec(spec),
+		minSCTs:   spec.MinSCTs,
+		gen:       &hvcaGeneration{clnt: clnt, ctx: clntCtx, cancel: cancel},
+		policyTTL: policyTTL,
+	}, nil
+}
+
+// ctLogsFromSpec converts the CT logs an IssuerSpec lists into the form
+// CollectSCTs expects.
+func ctLogsFromSpec(spec *sampleissuerapi.IssuerSpec) []CTLog {
+	logs := make([]CTLog, 0, len(spec.CTLogs))
+	for _, l := range spec.CTLogs {
+		logs = append(logs, CTLog{URL: l.URL, PublicKey: l.PublicKey})
+	}
+	return logs
+}
+
+// hsmConfigFromSecretData builds an hsm.Config from the secret data when
+// the issuer is configured to keep its mTLS key on a PKCS#11 token rather
+// than a PEM-encoded "certkey" entry. The secret carries the token's PIN
+// and key locator alongside the module path, mirroring how apikey/apisecret
+// are already read from the same secret.
+func hsmConfigFromSecretData(secret map[string][]byte) (hsm.Config, bool) {
+	modulePath := string(secret["hsmModulePath"])
+	if modulePath == "" {
+		return hsm.Config{}, false
+	}
+	var slot uint64
+	if s := string(secret["hsmSlot"]); s != "" {
+		slot, _ = strconv.ParseUint(s, 10, 32)
+	}
+	return hsm.Config{
+		ModulePath: modulePath,
+		Slot:       uint(slot),
+		Pin:        string(secret["hsmPin"]),
+		KeyLabel:   string(secret["hsmKeyLabel"]),
+		KeyID:      secret["hsmKeyID"],
+	}, true
+}
+
+// filterStrings returns the subset of in whose values are present in allowed.
+func filterStrings(in []string, allowed map[string]bool) []string {
+	out := in[:0]
+	for _, s := range in {
+		if allowed[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// oidExtensionKeyUsage and oidExtensionExtendedKeyUsage are the well-known
+// X.509 extension OIDs (RFC 5280 §4.2.1.3, §4.2.1.12).
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// extKeyUsageOIDs maps RFC 5280 extended key usage OIDs, in dotted form, to
+// their x509.ExtKeyUsage values; these are the same identifiers Go's own x509 package recognizes when parsing a
+// certificate's extended key usage extension.
+var extKeyUsageOIDs = map[string]x509.ExtKeyUsage{
+	"1.3.6.1.5.5.7.3.1": x509.ExtKeyUsageServerAuth,
+	"1.3.6.1.5.5.7.3.2": x509.ExtKeyUsageClientAuth,
+	"1.3.6.1.5.5.7.3.3": x509.ExtKeyUsageCodeSigning,
+	"1.3.6.1.5.5.7.3.4": x509.ExtKeyUsageEmailProtection,
+	"1.3.6.1.5.5.7.3.8": x509.ExtKeyUsageTimeStamping,
+	"1.3.6.1.5.5.7.3.9": x509.ExtKeyUsageOCSPSigning,
+	"2.5.29.37.0":       x509.ExtKeyUsageAny,
 }
 
+// enforceCSRUsages rejects a CSR that requests key usages or extended key
+// usages beyond what profile grants. hvclient.Request has no field to
+// carry a usage restriction through to HVCA, so this is enforced against
+// the CSR's own requested extensions instead of the outgoing request.
+func enforceCSRUsages(csr *x509.CertificateRequest, profile *Profile) error {
+	grantedKU, grantedEKU, err := profile.x509Usages()
+	if err != nil {
+		return err
+	}
+	grantedEKUSet := make(map[x509.ExtKeyUsage]bool, len(grantedEKU))
+	for _, u := range grantedEKU {
+		grantedEKUSet[u] = true
+	}
+
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &bits); err != nil {
+				return fmt.Errorf("csr requests a key usage extension that can't be parsed: %w", err)
+			}
+			requested := x509.KeyUsage(0)
+			for i := 0; i < 9; i++ {
+				if bits.At(i) != 0 {
+					requested |= 1 << uint(i)
+				}
+			}
+			if requested&^grantedKU != 0 {
+				return errors.New("csr requests key usages not granted by the selected profile")
+			}
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+				return fmt.Errorf("csr requests an extended key usage extension that can't be parsed: %w", err)
+			}
+			for _, oid := range oids {
+				eku, known := extKeyUsageOIDs[oid.String()]
+				if !known || !grantedEKUSet[eku] {
+					return fmt.Errorf("csr requests extended key usage %s not granted by profile", oid.String())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hvcaClient is the subset of *hvclient.Client that hvcaSigner depends on.
+// Extracting it lets tests and benchmarks substitute a fake instead of
+// performing a real mTLS handshake against HVCA.
+type hvcaClient interface {
+	Policy(ctx context.Context) (*hvclient.Policy, error)
+	CertificateRequest(ctx context.Context, req *hvclient.Request) (*big.Int, error)
+	CertificateRetrieve(ctx context.Context, serial *big.Int) (*hvclient.CertInfo, error)
+	TrustChain(ctx context.Context) ([]*x509.Certificate, error)
+}
+
+var _ hvcaClient = (*hvclient.Client)(nil)
+
 type hvcaSigner struct {
 	config *hvclient.Config
+	// profile is the operator-defined issuance policy selected by the
+	// issuer, if any. A nil profile preserves the original behaviour of
+	// signing purely off of the CSR and the atlas validation policy.
+	profile *Profile
+
+	// ctLogs are the Certificate Transparency logs issued chains are
+	// submitted to. Empty disables the CT stage entirely.
+	ctLogs []CTLog
+	// minSCTs is the minimum number of logs that must accept a chain
+	// before Sign succeeds. Only consulted when ctLogs is non-empty.
+	minSCTs int
+
+	sctMu    sync.Mutex
+	lastSCTs []SCT
+
+	// mu guards gen so Refresh can swap it out from under an in-flight Sign
+	// call when the issuer's secret rotates.
+	mu  sync.Mutex
+	gen *hvcaGeneration
+
+	// policyTTL controls how long a fetched validation policy is reused
+	// before Sign fetches it again.
+	policyTTL       time.Duration
+	policyMu        sync.Mutex
+	cachedPolicy    *hvclient.Policy
+	policyFetchedAt time.Time
+}
+
+// hvcaGeneration bundles one "version" of the HVCA mTLS client with the
+// context that owns its connection and a count of the Sign calls currently
+// using it. Refresh swaps in a new generation but leaves the old one's
+// context alone until wg drains, so rotating the issuer's secret can't
+// cancel a CertificateRequest/CertificateRetrieve that's already in flight.
+type hvcaGeneration struct {
+	clnt   hvcaClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// policy returns the cached validation policy if it's still within
+// policyTTL, otherwise fetches a fresh one from HVCA. A 403/policy
+// violation response clears the cache so the next Sign call refetches it
+// rather than continuing to trust a stale policy.
+func (o *hvcaSigner) policy(ctx context.Context) (*hvclient.Policy, error) {
+	o.policyMu.Lock()
+	defer o.policyMu.Unlock()
+
+	if o.cachedPolicy != nil && time.Since(o.policyFetchedAt) < o.policyTTL {
+		return o.cachedPolicy, nil
+	}
+
+	o.mu.Lock()
+	gen := o.gen
+	o.mu.Unlock()
+
+	vp, err := gen.clnt.Policy(ctx)
+	if err != nil {
+		if isPolicyViolation(err) {
+			o.cachedPolicy = nil
+		}
+		return nil, err
+	}
+	o.cachedPolicy = vp
+	o.policyFetchedAt = time.Now()
+	return vp, nil
+}
+
+// invalidatePolicy drops the cached policy so the next Sign call fetches
+// a fresh one.
+func (o *hvcaSigner) invalidatePolicy() {
+	o.policyMu.Lock()
+	o.cachedPolicy = nil
+	o.policyMu.Unlock()
+}
+
+// isPolicyViolation reports whether err looks like HVCA rejected a
+// request because it violates the account's validation policy, which
+// means a cached policy may now be stale.
+func isPolicyViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "403") || strings.Contains(msg, "policy")
+}
+
+// Refresh rebuilds the mTLS credentials and HVCA client from rotated
+// secret data, swapping them into the running signer. The controller
+// calls this from its Secret watch when the issuer's credentials rotate,
+// instead of requiring the issuer to be deleted and recreated. Only the
+// HVCA config and client are swapped; the profile, CT logs, minSCTs and
+// policy TTL keep the values the signer was built with.
+func (o *hvcaSigner) Refresh(spec *sampleissuerapi.IssuerSpec, secret map[string][]byte, profiles ProfileSet) error {
+	fresh, err := HVCASignerFromIssuerAndSecretData(spec, secret, profiles)
+	if err != nil {
+		return err
+	}
+	freshSigner := fresh.(*hvcaSigner)
+
+	o.mu.Lock()
+	oldGen := o.gen
+	o.config = freshSigner.config
+	o.gen = freshSigner.gen
+	o.mu.Unlock()
+
+	o.invalidatePolicy()
+	// Don't cancel the old generation's context until every Sign call that
+	// already captured it has finished: those calls derived their own
+	// per-request context from oldGen.ctx, so cancelling it immediately
+	// would abort a CertificateRequest/CertificateRetrieve mid-flight.
+	go func() {
+		oldGen.wg.Wait()
+		oldGen.cancel()
+	}()
+	return nil
+}
+
+// Close cancels the signer's HVCA client context, tearing down its mTLS
+// connection. The controller calls this when the owning Issuer is
+// deleted.
+func (o *hvcaSigner) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.gen != nil {
+		o.gen.cancel()
+	}
+	return nil
+}
+
+// SCTProvider is implemented by signers that can staple Certificate
+// Transparency SCTs onto the certificate they most recently issued. The
+// controller type-asserts a Signer against this to populate
+// CertificateStatus for exposure via a TLS extension.
+type SCTProvider interface {
+	LastSCTs() []SCT
+}
+
+// LastSCTs returns the SCTs collected for the most recent successful Sign
+// call, or nil when CT submission is disabled or hasn't run yet.
+func (o *hvcaSigner) LastSCTs() []SCT {
+	o.sctMu.Lock()
+	defer o.sctMu.Unlock()
+	return o.lastSCTs
 }
 
 func (o *hvcaSigner) Check() error {
@@ -68,15 +423,22 @@ func (o *hvcaSigner) Check() error {
 }
 
 func (o *hvcaSigner) Sign(csrBytes []byte) ([]byte, []byte, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	var clnt *hvclient.Client
+	o.mu.Lock()
+	gen := o.gen
+	o.mu.Unlock()
+
+	// Registering with gen.wg before Refresh can swap o.gen out from under
+	// us is what lets Refresh know it's safe to cancel gen.ctx: it won't,
+	// until this call (and every other one holding the same generation)
+	// has called Done.
+	gen.wg.Add(1)
+	defer gen.wg.Done()
+
+	ctx, cancel := context.WithCancel(gen.ctx)
 	var serial *big.Int
 	var info *hvclient.CertInfo
 	var caChainList []*x509.Certificate
 	defer cancel()
-	if clnt, err = hvclient.NewClient(ctx, o.config); err != nil {
-		return nil, nil, err
-	}
 	// Parse the csr
 	csr, err := parseCSR(csrBytes)
 	if err != nil {
@@ -90,11 +452,35 @@ func (o *hvcaSigner) Sign(csrBytes []byte) ([]byte, []byte, error) {
 		Validity:  &hvclient.Validity{NotBefore: time.Now(), NotAfter: time.Unix(0, 0)},
 		Signature: &hvclient.Signature{},
 	}
-	// Pull the validation policy and check it for required fields
-	vp, err := clnt.Policy(ctx)
+	// Pull the validation policy (cached for policyTTL) and check it for
+	// required fields
+	vp, err := o.policy(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
+	if o.profile != nil {
+		if err := o.profile.validateAgainstPolicy(vp); err != nil {
+			return nil, nil, err
+		}
+		expiry, err := time.ParseDuration(o.profile.Expiry)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Validity.NotAfter = req.Validity.NotBefore.Add(expiry)
+		if allowed := o.profile.allowedSANSet(); allowed != nil {
+			csr.DNSNames = filterStrings(csr.DNSNames, allowed)
+			ips := csr.IPAddresses[:0]
+			for _, ip := range csr.IPAddresses {
+				if allowed[ip.String()] {
+					ips = append(ips, ip)
+				}
+			}
+			csr.IPAddresses = ips
+		}
+		if err := enforceCSRUsages(csr, o.profile); err != nil {
+			return nil, nil, err
+		}
+	}
 	// Subject validation
 	// common name
 	if vp.SubjectDN.CommonName.Presence == hvclient.Required {
@@ -151,18 +537,34 @@ func (o *hvcaSigner) Sign(csrBytes []byte) ([]byte, []byte, error) {
 		req.Signature.HashAlgorithm = vp.SignaturePolicy.HashAlgorithm.List[0]
 	}
 	// Request cert
-	if serial, err = clnt.CertificateRequest(ctx, &req); err != nil {
+	if serial, err = gen.clnt.CertificateRequest(ctx, &req); err != nil {
+		if isPolicyViolation(err) {
+			o.invalidatePolicy()
+		}
 		return nil, nil, err
 	}
 	// Retrieve cert
-	if info, err = clnt.CertificateRetrieve(ctx, serial); err != nil {
+	if info, err = gen.clnt.CertificateRetrieve(ctx, serial); err != nil {
 		return nil, nil, err
 	}
 	// Retrieve ca chain
-	if caChainList, err = clnt.TrustChain(ctx); err != nil {
+	if caChainList, err = gen.clnt.TrustChain(ctx); err != nil {
 		return nil, nil, err
 	}
 
+	if len(o.ctLogs) > 0 {
+		scts, err := CollectSCTs(o.ctLogs, append([]*x509.Certificate{info.X509}, caChainList...))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := EnforceMinSCTs(scts, o.minSCTs); err != nil {
+			return nil, nil, err
+		}
+		o.sctMu.Lock()
+		o.lastSCTs = scts
+		o.sctMu.Unlock()
+	}
+
 	// Convert CA Chain into PEM
 	var caChain []byte
 	for _, cert := range caChainList {
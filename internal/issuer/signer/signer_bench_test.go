@@ -0,0 +1,59 @@
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/globalsign/hvclient"
+)
+
+// fakeHVCAClient stands in for a real *hvclient.Client so this benchmark
+// can measure the signer's own overhead instead of a network round trip
+// and mTLS handshake.
+type fakeHVCAClient struct {
+	policyCalls int64
+}
+
+func (f *fakeHVCAClient) Policy(ctx context.Context) (*hvclient.Policy, error) {
+	atomic.AddInt64(&f.policyCalls, 1)
+	time.Sleep(time.Millisecond) // stand in for HVCA's policy endpoint latency
+	return &hvclient.Policy{}, nil
+}
+
+func (f *fakeHVCAClient) CertificateRequest(ctx context.Context, req *hvclient.Request) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
+func (f *fakeHVCAClient) CertificateRetrieve(ctx context.Context, serial *big.Int) (*hvclient.CertInfo, error) {
+	return &hvclient.CertInfo{}, nil
+}
+
+func (f *fakeHVCAClient) TrustChain(ctx context.Context) ([]*x509.Certificate, error) {
+	return nil, nil
+}
+
+// BenchmarkPolicyCaching demonstrates that concurrent CSRs share one
+// cached policy fetch for policyTTL instead of each round-tripping to
+// HVCA, which is what made every Sign call pay for a Policy() call before
+// this change.
+func BenchmarkPolicyCaching(b *testing.B) {
+	fake := &fakeHVCAClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := &hvcaSigner{gen: &hvcaGeneration{clnt: fake, ctx: ctx, cancel: cancel}, policyTTL: time.Minute}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := o.policy(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.ReportMetric(float64(atomic.LoadInt64(&fake.policyCalls)), "policy-fetches")
+}
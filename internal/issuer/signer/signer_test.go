@@ -0,0 +1,107 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/globalsign/hvclient"
+)
+
+// policyErr wraps the injected error so that atomic.Value always stores one
+// concrete, non-nil type, including when the error is cleared to nil.
+type policyErr struct{ err error }
+
+type countingPolicyClient struct {
+	fakeHVCAClient
+	err atomic.Value
+}
+
+func (c *countingPolicyClient) Policy(ctx context.Context) (*hvclient.Policy, error) {
+	if e, ok := c.err.Load().(policyErr); ok && e.err != nil {
+		atomic.AddInt64(&c.policyCalls, 1)
+		return nil, e.err
+	}
+	return c.fakeHVCAClient.Policy(ctx)
+}
+
+func TestPolicyIsCachedWithinTTL(t *testing.T) {
+	clnt := &countingPolicyClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := &hvcaSigner{gen: &hvcaGeneration{clnt: clnt, ctx: ctx, cancel: cancel}, policyTTL: time.Hour}
+
+	if _, err := o.policy(ctx); err != nil {
+		t.Fatalf("first policy() call returned error: %v", err)
+	}
+	if _, err := o.policy(ctx); err != nil {
+		t.Fatalf("second policy() call returned error: %v", err)
+	}
+	if got := atomic.LoadInt64(&clnt.policyCalls); got != 1 {
+		t.Fatalf("expected the second call to be served from cache, got %d upstream calls", got)
+	}
+}
+
+func TestPolicyRefetchesAfterTTLExpires(t *testing.T) {
+	clnt := &countingPolicyClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := &hvcaSigner{gen: &hvcaGeneration{clnt: clnt, ctx: ctx, cancel: cancel}, policyTTL: time.Nanosecond}
+
+	if _, err := o.policy(ctx); err != nil {
+		t.Fatalf("first policy() call returned error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := o.policy(ctx); err != nil {
+		t.Fatalf("second policy() call returned error: %v", err)
+	}
+	if got := atomic.LoadInt64(&clnt.policyCalls); got != 2 {
+		t.Fatalf("expected the expired cache entry to trigger a refetch, got %d upstream calls", got)
+	}
+}
+
+// invalidatePolicy is called directly here, standing in for the call Sign
+// makes when CertificateRequest fails with a policy violation.
+func TestPolicyRefetchedAfterInvalidation(t *testing.T) {
+	clnt := &countingPolicyClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := &hvcaSigner{gen: &hvcaGeneration{clnt: clnt, ctx: ctx, cancel: cancel}, policyTTL: time.Hour}
+
+	if _, err := o.policy(ctx); err != nil {
+		t.Fatalf("first policy() call returned error: %v", err)
+	}
+
+	clnt.err.Store(policyErr{errors.New("403: policy violation")})
+	o.invalidatePolicy()
+	if _, err := o.policy(ctx); err == nil {
+		t.Fatal("expected policy() to surface the upstream error")
+	}
+
+	clnt.err.Store(policyErr{})
+	if _, err := o.policy(ctx); err != nil {
+		t.Fatalf("expected policy() to recover once the upstream call succeeds again: %v", err)
+	}
+	if got := atomic.LoadInt64(&clnt.policyCalls); got != 3 {
+		t.Fatalf("expected 3 upstream calls (initial, violation, recovery), got %d", got)
+	}
+}
+
+func TestIsPolicyViolation(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection reset"), false},
+		{errors.New("403 Forbidden"), true},
+		{errors.New("atlas validation policy violation"), true},
+	}
+	for _, c := range cases {
+		if got := isPolicyViolation(c.err); got != c.want {
+			t.Errorf("isPolicyViolation(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package hsm provides a crypto.Signer backed by a PKCS#11 token so that
+// mTLS client keys (softhsm2, OpenSC-compatible smartcards, AWS CloudHSM)
+// never have to leave the module. The HVCA signer uses this to populate
+// hvconfig.TLSKey without ever holding the raw private key in process
+// memory. Both RSA and ECDSA (P-256/P-384/P-521) token keys are supported.
+package hsm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+)
+
+// Config describes how to locate a PKCS#11 token and the key on it.
+type Config struct {
+	// ModulePath is the filesystem path to the PKCS#11 shared library,
+	// e.g. /usr/lib/softhsm/libsofthsm2.so or the CloudHSM client lib.
+	ModulePath string
+	// Slot is the PKCS#11 slot holding the token.
+	Slot uint
+	// Pin authenticates the session against the token.
+	Pin string
+	// KeyLabel is the CKA_LABEL of the private key object to sign with.
+	// One of KeyLabel or KeyID must be set.
+	KeyLabel string
+	// KeyID is the CKA_ID of the private key object.
+	KeyID []byte
+}
+
+// Signer is a crypto.Signer whose private key lives on a PKCS#11 token.
+// Sign delegates to the module; the key material never leaves it.
+type Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	handle  pkcs11.ObjectHandle
+	public  crypto.PublicKey
+}
+
+// Open loads the PKCS#11 module described by cfg, logs into the token and
+// locates the private key by label or CKA_ID. The returned Signer owns the
+// module and session; callers must call Close when done with it.
+func Open(cfg Config) (*Signer, error) {
+	if cfg.KeyLabel == "" && len(cfg.KeyID) == 0 {
+		return nil, errors.New("hsm: one of KeyLabel or KeyID is required")
+	}
+
+	ctx := pkcs11.New(cfg.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("hsm: unable to load PKCS#11 module %q", cfg.ModulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, fmt.Errorf("hsm: initialize module: %w", err)
+	}
+
+	session, err := ctx.OpenSession(cfg.Slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		ctx.Finalize()
+		return nil, fmt.Errorf("hsm: open session on slot %d: %w", cfg.Slot, err)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, cfg.Pin); err != nil {
+		ctx.CloseSession(session)
+		ctx.Finalize()
+		return nil, fmt.Errorf("hsm: login: %w", err)
+	}
+
+	handle, public, err := findKeyPair(ctx, session, cfg)
+	if err != nil {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		ctx.Finalize()
+		return nil, err
+	}
+
+	return &Signer{ctx: ctx, session: session, handle: handle, public: public}, nil
+}
+
+// findObject locates the single object of class (CKO_PRIVATE_KEY or
+// CKO_PUBLIC_KEY) matching cfg's label/CKA_ID.
+func findObject(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, cfg Config) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+	}
+	if cfg.KeyLabel != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, cfg.KeyLabel))
+	}
+	if len(cfg.KeyID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, cfg.KeyID))
+	}
+
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("hsm: find object: %w", err)
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	objs, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return 0, fmt.Errorf("hsm: find object: %w", err)
+	}
+	if len(objs) == 0 {
+		return 0, fmt.Errorf("hsm: no object found for label %q id %x", cfg.KeyLabel, cfg.KeyID)
+	}
+	return objs[0], nil
+}
+
+// findKeyPair locates the private key object by label or CKA_ID and reads
+// back the matching public key so Public() can be satisfied without
+// exporting anything from the private object.
+func findKeyPair(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, cfg Config) (pkcs11.ObjectHandle, crypto.PublicKey, error) {
+	priv, err := findObject(ctx, session, pkcs11.CKO_PRIVATE_KEY, cfg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("hsm: find private key: %w", err)
+	}
+	pub, err := findObject(ctx, session, pkcs11.CKO_PUBLIC_KEY, cfg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("hsm: find public key: %w", err)
+	}
+
+	typeAttr, err := ctx.GetAttributeValue(session, pub, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("hsm: read public key type: %w", err)
+	}
+
+	switch ulongFromBytes(typeAttr[0].Value) {
+	case pkcs11.CKK_RSA:
+		public, err := readRSAPublicKey(ctx, session, pub)
+		if err != nil {
+			return 0, nil, err
+		}
+		return priv, public, nil
+	case pkcs11.CKK_EC, pkcs11.CKK_ECDSA:
+		public, err := readECPublicKey(ctx, session, pub)
+		if err != nil {
+			return 0, nil, err
+		}
+		return priv, public, nil
+	default:
+		return 0, nil, fmt.Errorf("hsm: unsupported key type %d for label %q", ulongFromBytes(typeAttr[0].Value), cfg.KeyLabel)
+	}
+}
+
+func readRSAPublicKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, pub pkcs11.ObjectHandle) (*rsa.PublicKey, error) {
+	attrs, err := ctx.GetAttributeValue(session, pub, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hsm: read RSA public key attributes: %w", err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}, nil
+}
+
+// curveOIDs maps the named curves SoftHSM2/CloudHSM/OpenSC tokens
+// commonly report in CKA_EC_PARAMS to their Go elliptic.Curve.
+var curveOIDs = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+func readECPublicKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, pub pkcs11.ObjectHandle) (*ecdsa.PublicKey, error) {
+	attrs, err := ctx.GetAttributeValue(session, pub, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hsm: read EC public key attributes: %w", err)
+	}
+
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(attrs[0].Value, &oid); err != nil {
+		return nil, fmt.Errorf("hsm: parse CKA_EC_PARAMS: %w", err)
+	}
+	curve, ok := curveOIDs[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("hsm: unsupported EC curve %s", oid.String())
+	}
+
+	// CKA_EC_POINT is a DER OCTET STRING wrapping the uncompressed point;
+	// some tokens report the raw point instead, so fall back to that.
+	point := attrs[1].Value
+	var unwrapped []byte
+	if _, err := asn1.Unmarshal(point, &unwrapped); err == nil {
+		point = unwrapped
+	}
+
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, errors.New("hsm: invalid EC point in CKA_EC_POINT")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// ulongFromBytes decodes a PKCS#11 CK_ULONG attribute value, which
+// miekg/pkcs11 returns as the platform's native-endian raw bytes.
+func ulongFromBytes(b []byte) uint64 {
+	var v uint64
+	for i, by := range b {
+		v |= uint64(by) << (8 * i)
+	}
+	return v
+}
+
+// Public returns the public half of the key pair resolved when the Signer
+// was opened.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign asks the token to sign digest with the private key located at
+// Open-time. The raw key material is never read out of the module.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		return s.signRSA(digest, opts)
+	case *ecdsa.PublicKey:
+		return s.signECDSA(digest)
+	default:
+		return nil, fmt.Errorf("hsm: unsupported key type %T", s.public)
+	}
+}
+
+// signRSA signs digest under CKM_RSA_PKCS, the "raw" PKCS#1 v1.5
+// mechanism. CKM_RSA_PKCS expects to be handed a DigestInfo (the
+// ASN.1-wrapped hash algorithm identifier plus digest), not the bare
+// digest: the hash-and-sign mechanisms (CKM_SHA256_RSA_PKCS and friends)
+// would otherwise re-hash an already-computed digest and produce a
+// signature over SHA256(digest) instead of digest itself, which every TLS
+// stack verifying against the real digest would reject.
+func (s *Signer) signRSA(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+		return s.signRSAPSS(digest, pssOpts)
+	}
+	digestInfo, err := asn1DigestInfo(opts.HashFunc(), digest)
+	if err != nil {
+		return nil, err
+	}
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err := s.ctx.SignInit(s.session, mechanism, s.handle); err != nil {
+		return nil, fmt.Errorf("hsm: sign init: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, digestInfo)
+	if err != nil {
+		return nil, fmt.Errorf("hsm: sign: %w", err)
+	}
+	return sig, nil
+}
+
+// pssParams maps a hash algorithm to the PKCS#11 hash/MGF mechanism pair
+// CK_RSA_PKCS_PSS_PARAMS expects for that hash.
+var pssParams = map[crypto.Hash]struct{ hashAlg, mgf uint }{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// signRSAPSS signs digest under CKM_RSA_PKCS_PSS. TLS 1.3's
+// CertificateVerify mandates rsa_pss_rsae_* signatures, so crypto/tls
+// calls Sign with *rsa.PSSOptions for an RSA certificate key; rejecting
+// PSS here would make an RSA HSM key unusable for mTLS on a TLS 1.3
+// connection. Unlike CKM_RSA_PKCS, the PSS mechanism takes the hash
+// algorithm from its parameters and applies the PSS encoding to the
+// precomputed digest without hashing it again, so it's handed the bare
+// digest, not a DigestInfo.
+func (s *Signer) signRSAPSS(digest []byte, opts *rsa.PSSOptions) ([]byte, error) {
+	params, ok := pssParams[opts.Hash]
+	if !ok {
+		return nil, fmt.Errorf("hsm: unsupported hash algorithm %v for RSA-PSS signing", opts.Hash)
+	}
+	saltLength := uint(opts.Hash.Size())
+	switch opts.SaltLength {
+	case rsa.PSSSaltLengthAuto, rsa.PSSSaltLengthEqualsHash:
+		// saltLength already defaults to the hash size, which is what
+		// TLS 1.3 (and PSSSaltLengthEqualsHash) both require.
+	default:
+		saltLength = uint(opts.SaltLength)
+	}
+
+	mechanism := []*pkcs11.Mechanism{
+		pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(params.hashAlg, params.mgf, saltLength)),
+	}
+	if err := s.ctx.SignInit(s.session, mechanism, s.handle); err != nil {
+		return nil, fmt.Errorf("hsm: sign init: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("hsm: sign: %w", err)
+	}
+	return sig, nil
+}
+
+// digestInfoPrefixes are the DER-encoded DigestInfo prefixes (AlgorithmIdentifier
+// plus digest length) that precede the raw digest in a PKCS#1 v1.5 signature input.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+func asn1DigestInfo(hash crypto.Hash, digest []byte) ([]byte, error) {
+	prefix, ok := digestInfoPrefixes[hash]
+	if !ok {
+		return nil, fmt.Errorf("hsm: unsupported hash algorithm %v for RSA PKCS#1 signing", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("hsm: digest length %d does not match hash %v", len(digest), hash)
+	}
+	info := make([]byte, 0, len(prefix)+len(digest))
+	info = append(info, prefix...)
+	info = append(info, digest...)
+	return info, nil
+}
+
+// signECDSA signs digest under CKM_ECDSA, which (unlike the RSA
+// hash-and-sign mechanisms) operates directly on an already-computed
+// digest. PKCS#11 returns the signature as a fixed-width r||s
+// concatenation; crypto.Signer implementations are expected to return an
+// ASN.1 DER-encoded signature, so it's re-encoded before returning.
+func (s *Signer) signECDSA(digest []byte) ([]byte, error) {
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}
+	if err := s.ctx.SignInit(s.session, mechanism, s.handle); err != nil {
+		return nil, fmt.Errorf("hsm: sign init: %w", err)
+	}
+	raw, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("hsm: sign: %w", err)
+	}
+	if len(raw)%2 != 0 {
+		return nil, fmt.Errorf("hsm: unexpected ECDSA signature length %d", len(raw))
+	}
+	half := len(raw) / 2
+	r := new(big.Int).SetBytes(raw[:half])
+	sVal := new(big.Int).SetBytes(raw[half:])
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sVal})
+}
+
+// Close logs out of the token and releases the module. The Signer must
+// not be used afterwards.
+func (s *Signer) Close() error {
+	s.ctx.Logout(s.session)
+	if err := s.ctx.CloseSession(s.session); err != nil {
+		s.ctx.Finalize()
+		return err
+	}
+	s.ctx.Finalize()
+	return nil
+}
+
+// HealthChecker confirms that a PKCS#11-backed key is still reachable by
+// opening a fresh session and resolving the key handle.
+type HealthChecker struct {
+	cfg Config
+}
+
+// NewHealthChecker returns a HealthChecker for the token described by cfg.
+func NewHealthChecker(cfg Config) *HealthChecker {
+	return &HealthChecker{cfg: cfg}
+}
+
+// Check opens a session against the token and verifies the configured key
+// can still be found, then tears the session back down.
+func (h *HealthChecker) Check() error {
+	s, err := Open(h.cfg)
+	if err != nil {
+		return err
+	}
+	return s.Close()
+}